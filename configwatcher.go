@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rwynn/esroll/esclient"
+	"sigs.k8s.io/yaml"
+)
+
+// logger is esroll's structured logger, used throughout the package in
+// place of the ad-hoc log.Println calls it used to make. It lives here
+// because ConfigWatcher was the first caller to need leveled, structured
+// fields rather than a one-line message.
+var logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+// fingerprint is the per-document change marker esroll uses to avoid
+// re-parsing and re-validating configuration documents that have not
+// changed since the last refresh.
+type fingerprint struct {
+	SeqNo       int64
+	PrimaryTerm int64
+}
+
+// ConfigWatcher tracks the last-seen fingerprint of every esroll
+// configuration, whether it came from the esroll index or a local
+// -config-dir, and reports only what changed on each Refresh. mu guards
+// seen/configs, since Refresh runs off the daemon's configTicker while
+// LoadDir can run concurrently off WatchDir's fsnotify goroutine.
+type ConfigWatcher struct {
+	client    esclient.EsClient
+	configDir string
+	mu        sync.Mutex
+	seen      map[string]fingerprint
+	configs   map[string]IndexConfig
+}
+
+// NewConfigWatcher builds a watcher against client. configDir may be empty,
+// in which case only the esroll index is consulted.
+func NewConfigWatcher(client esclient.EsClient, configDir string) *ConfigWatcher {
+	return &ConfigWatcher{
+		client:    client,
+		configDir: configDir,
+		seen:      make(map[string]fingerprint),
+		configs:   make(map[string]IndexConfig),
+	}
+}
+
+// Refresh reads the configuration documents SearchConfigs returns from the
+// esroll index,
+// re-parsing and re-validating only those whose _seq_no/_primary_term pair
+// changed since the last call. It returns the configs that are new or
+// changed so callers can bootstrap them immediately instead of waiting for
+// the next tick. Note that the ES 5/6 backend does not report seq_no on
+// search hits, so documents served through it are always re-parsed.
+func (w *ConfigWatcher) Refresh() (changed []IndexConfig, reloadErrors int, err error) {
+	docs, err := w.client.SearchConfigs(context.Background(), "esroll")
+	if err != nil {
+		return nil, 0, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	alive := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		alive[doc.Id] = true
+		fp := fingerprint{SeqNo: doc.SeqNo, PrimaryTerm: doc.PrimaryTerm}
+		if existing, ok := w.seen[doc.Id]; ok && existing == fp && fp != (fingerprint{}) {
+			continue
+		}
+		var configData IndexConfig
+		if unmarshalErr := json.Unmarshal(doc.Source, &configData); unmarshalErr != nil {
+			logger.Error("invalid config document", "config", doc.Id, "error", unmarshalErr)
+			reloadErrors++
+			continue
+		}
+		configData.Id = doc.Id
+		configData.SetDefaults()
+		if validateErr := configData.Validate(); validateErr != nil {
+			logger.Error("invalid config document", "config", doc.Id, "error", validateErr)
+			reloadErrors++
+			continue
+		}
+		w.seen[doc.Id] = fp
+		w.configs[doc.Id] = configData
+		changed = append(changed, configData)
+	}
+	for id := range w.configs {
+		if alive[id] {
+			continue
+		}
+		// Configs loaded by LoadDir are not in the esroll index; keep those
+		// whose file is still in configDir.
+		fromDir := false
+		for _, ext := range []string{".json", ".yaml", ".yml"} {
+			if _, statErr := os.Stat(filepath.Join(w.configDir, id+ext)); w.configDir != "" && statErr == nil {
+				fromDir = true
+			}
+		}
+		if !fromDir {
+			delete(w.configs, id)
+			delete(w.seen, id)
+		}
+	}
+	return changed, reloadErrors, nil
+}
+
+// Configs returns every currently known configuration, from both the esroll
+// index and -config-dir.
+func (w *ConfigWatcher) Configs() Configs {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	configs := make(Configs, 0, len(w.configs))
+	for _, c := range w.configs {
+		configs = append(configs, c)
+	}
+	return configs
+}
+
+// LoadDir parses every .json/.yaml/.yml file in configDir as an IndexConfig,
+// using the file's base name (without extension) as the config id. It
+// returns the configs that are new or changed, the same way Refresh does
+// for the esroll index.
+func (w *ConfigWatcher) LoadDir() (changed []IndexConfig, err error) {
+	if w.configDir == "" {
+		return nil, nil
+	}
+	entries, err := ioutil.ReadDir(w.configDir)
+	if err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, entry := range entries {
+		if entry.IsDir() || !isConfigFile(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(w.configDir, entry.Name())
+		body, readErr := ioutil.ReadFile(path)
+		if readErr != nil {
+			logger.Error("unable to read config file", "path", path, "error", readErr)
+			continue
+		}
+		id := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		fp := fingerprint{SeqNo: int64(len(body)), PrimaryTerm: int64(hashBytes(body))}
+		if existing, ok := w.seen[id]; ok && existing == fp {
+			continue
+		}
+		var configData IndexConfig
+		if yamlErr := yaml.Unmarshal(body, &configData); yamlErr != nil {
+			logger.Error("unable to parse config file", "path", path, "error", yamlErr)
+			continue
+		}
+		configData.Id = id
+		configData.SetDefaults()
+		if validateErr := configData.Validate(); validateErr != nil {
+			logger.Error("invalid config file", "path", path, "error", validateErr)
+			continue
+		}
+		w.seen[id] = fp
+		w.configs[id] = configData
+		changed = append(changed, configData)
+	}
+	return changed, nil
+}
+
+func isConfigFile(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".json" || ext == ".yaml" || ext == ".yml"
+}
+
+// hashBytes is a tiny, dependency-free checksum used only to detect changed
+// config files; it does not need to be cryptographically strong.
+func hashBytes(body []byte) uint32 {
+	var h uint32 = 2166136261
+	for _, b := range body {
+		h ^= uint32(b)
+		h *= 16777619
+	}
+	return h
+}
+
+// WatchDir watches configDir with fsnotify and pushes every new or changed
+// config onto updates as soon as the filesystem reports it, for air-gapped
+// setups where writing to the esroll index is undesirable.
+func (w *ConfigWatcher) WatchDir(updates chan<- IndexConfig) error {
+	if w.configDir == "" {
+		return nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(w.configDir); err != nil {
+		watcher.Close()
+		return err
+	}
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !isConfigFile(event.Name) {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				changed, err := w.LoadDir()
+				if err != nil {
+					logger.Error("unable to reload config-dir", "dir", w.configDir, "error", err)
+					continue
+				}
+				for _, c := range changed {
+					updates <- c
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Error("config-dir watch error", "dir", w.configDir, "error", err)
+			}
+		}
+	}()
+	return nil
+}
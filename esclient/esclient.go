@@ -0,0 +1,183 @@
+// Package esclient abstracts the handful of Elasticsearch/OpenSearch
+// operations esroll needs behind a single interface, so that callers do not
+// depend on the wire format of any one olivere/elastic major version.
+//
+// Elasticsearch broke API compatibility several times in ways that matter
+// here: TotalHits went from an int to a struct, Source went from a pointer
+// to a json.RawMessage, and _optimize was renamed/removed in favor of
+// _forcemerge. Rather than pin esroll to one client library, New probes the
+// cluster's reported version and returns the implementation that matches.
+package esclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CatIndex mirrors the subset of a _cat/indices row that esroll cares about.
+type CatIndex struct {
+	Name         string
+	Status       string
+	PriStoreSize string
+}
+
+// ConfigDoc is a single esroll configuration document read from the esroll
+// index, with its raw JSON body and the sequence metadata needed to detect
+// changes without re-parsing unchanged documents.
+type ConfigDoc struct {
+	Id          string
+	Source      []byte
+	SeqNo       int64
+	PrimaryTerm int64
+}
+
+// AliasAction is one add or remove step in a batched alias update, matching
+// the shape of the alias actions esroll has always issued in a single Roll.
+type AliasAction struct {
+	Index  string
+	Alias  string
+	Remove bool
+}
+
+// RolloverConditions mirrors the condition fields the Elasticsearch Rollover
+// API accepts: maxAge, maxDocs, and maxSize. A zero value for a field means
+// that condition is omitted from the rollover request.
+type RolloverConditions struct {
+	MaxAge  string
+	MaxDocs int64
+	MaxSize string
+}
+
+// RolloverResult reports what the cluster actually did in response to a
+// rollover request: whether the conditions were met and, if so, the names
+// of the old and new indices.
+type RolloverResult struct {
+	RolledOver bool
+	OldIndex   string
+	NewIndex   string
+}
+
+// EsClient is the set of cluster operations IndexConfig.Roll and its helpers
+// need. Implementations must be safe for concurrent use by the daemon loop.
+type EsClient interface {
+	// Version returns the cluster's reported version string, e.g. "7.17.9".
+	Version(ctx context.Context) (string, error)
+
+	IndexExists(ctx context.Context, name string) (bool, error)
+	CreateIndex(ctx context.Context, name string, settings map[string]interface{}) error
+	// CreateIndexWithWriteAlias creates name with settings and attaches it to
+	// alias as the write index (is_write_index: true), bootstrapping the
+	// first index behind a rollover alias.
+	CreateIndexWithWriteAlias(ctx context.Context, name, alias string, settings map[string]interface{}) error
+	// Rollover POSTs conditions to alias/_rollover, letting the cluster
+	// atomically create the next index and flip the write alias when a
+	// condition is met.
+	Rollover(ctx context.Context, alias string, conditions RolloverConditions) (RolloverResult, error)
+	CatIndices(ctx context.Context, pattern string) ([]CatIndex, error)
+	ApplyAliases(ctx context.Context, actions []AliasAction) error
+	DeleteIndices(ctx context.Context, names []string) error
+	CloseIndices(ctx context.Context, names []string) error
+	FlushIndices(ctx context.Context, names []string) error
+	PutSettings(ctx context.Context, names []string, settings map[string]interface{}) error
+	Forcemerge(ctx context.Context, names []string, maxSegments int) error
+	// AliasExists reports whether alias is currently attached to index, used
+	// to mark an ILM-style phase action as already applied.
+	AliasExists(ctx context.Context, index, alias string) (bool, error)
+	// Shrink creates target as a single-primary (or numberOfShards-primary)
+	// copy of source via the Shrink API.
+	Shrink(ctx context.Context, source, target string, settings map[string]interface{}) error
+	// Freeze marks index as frozen. Not every backend supports this; see the
+	// per-version implementations.
+	Freeze(ctx context.Context, index string) error
+
+	// SearchConfigs returns the documents of the esroll configuration index
+	// from a single search request at the search API's default page size, so
+	// at most 10 documents are returned.
+	SearchConfigs(ctx context.Context, index string) ([]ConfigDoc, error)
+
+	// Reindex submits an asynchronous _reindex from source to dest and
+	// returns the id of the task driving it, for use with TaskCompleted.
+	Reindex(ctx context.Context, source, dest string, opts ReindexOptions) (task string, err error)
+	// TaskCompleted reports whether the task started by Reindex has
+	// finished.
+	TaskCompleted(ctx context.Context, task string) (bool, error)
+}
+
+// ReindexOptions narrows a _reindex call the way OnRoll.Reindex exposes it:
+// a cap on the number of documents to copy, an optional query to select a
+// subset instead of all of them, an ingest pipeline to transform documents
+// in flight, and a slicing hint for parallelism.
+type ReindexOptions struct {
+	MaxDocs  int64
+	Query    map[string]interface{}
+	Pipeline string
+	Slices   string
+}
+
+// Options configures how New dials the cluster before version detection.
+type Options struct {
+	URL        string
+	User       string
+	Password   string
+	HTTPClient *http.Client
+	Scheme     string
+}
+
+// New pings the cluster at opts.URL and returns the EsClient implementation
+// matching its reported major version: 5 or 6 use the legacy
+// github.com/olivere/elastic client, 7 uses olivere/elastic/v7, and 8 uses
+// elastic/go-elasticsearch/v8. This is the same version-sniffing approach
+// other Go ES tools use to pick between elasticsearch5/6/7 packages.
+func New(ctx context.Context, opts Options) (EsClient, error) {
+	version, err := ping(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine elasticsearch version: %w", err)
+	}
+	major, err := majorVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case major >= 8:
+		return newV8Client(opts, version)
+	case major == 7:
+		return newV7Client(opts, version)
+	case major == 5 || major == 6:
+		return newV5Client(opts, version)
+	default:
+		return nil, fmt.Errorf("unsupported elasticsearch major version %d (from %q)", major, version)
+	}
+}
+
+// conditionsMap renders RolloverConditions as the map of ES condition names
+// (max_age, max_docs, max_size) the _rollover API expects, omitting any
+// condition that was left unset.
+func conditionsMap(conditions RolloverConditions) map[string]interface{} {
+	m := make(map[string]interface{})
+	if conditions.MaxAge != "" {
+		m["max_age"] = conditions.MaxAge
+	}
+	if conditions.MaxDocs != 0 {
+		m["max_docs"] = conditions.MaxDocs
+	}
+	if conditions.MaxSize != "" {
+		m["max_size"] = conditions.MaxSize
+	}
+	return m
+}
+
+func majorVersion(version string) (int, error) {
+	parts := strings.SplitN(version, ".", 2)
+	if len(parts) == 0 || parts[0] == "" {
+		return 0, errors.New("empty elasticsearch version string")
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse elasticsearch version %q: %w", version, err)
+	}
+	return major, nil
+}
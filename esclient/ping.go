@@ -0,0 +1,52 @@
+package esclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type pingResponse struct {
+	Version struct {
+		Number string `json:"number"`
+	} `json:"version"`
+}
+
+// ping issues a plain GET against the cluster root and returns the reported
+// version number. It deliberately avoids any of the versioned client
+// libraries, since which one to construct is exactly the question New is
+// trying to answer.
+func ping(ctx context.Context, opts Options) (string, error) {
+	if opts.URL == "" {
+		return "", errors.New("elasticsearch url is required")
+	}
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, opts.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	if opts.User != "" {
+		req.SetBasicAuth(opts.User, opts.Password)
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return "", fmt.Errorf("ping to %s returned status %d", opts.URL, res.StatusCode)
+	}
+	var body pingResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Version.Number == "" {
+		return "", fmt.Errorf("ping to %s did not report a version", opts.URL)
+	}
+	return body.Version.Number, nil
+}
@@ -0,0 +1,225 @@
+package esclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/olivere/elastic"
+)
+
+// v5Client implements EsClient for Elasticsearch 5.x and 6.x clusters using
+// the legacy github.com/olivere/elastic package, matching the API esroll
+// has always spoken to those versions.
+type v5Client struct {
+	client  *elastic.Client
+	version string
+}
+
+func newV5Client(opts Options, version string) (EsClient, error) {
+	var clientOptions []elastic.ClientOptionFunc
+	if opts.Scheme != "" {
+		clientOptions = append(clientOptions, elastic.SetScheme(opts.Scheme))
+	}
+	if opts.URL != "" {
+		clientOptions = append(clientOptions, elastic.SetURL(opts.URL))
+	}
+	if opts.User != "" {
+		clientOptions = append(clientOptions, elastic.SetBasicAuth(opts.User, opts.Password))
+	}
+	if opts.HTTPClient != nil {
+		clientOptions = append(clientOptions, elastic.SetHttpClient(opts.HTTPClient))
+	}
+	client, err := elastic.NewClient(clientOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return &v5Client{client: client, version: version}, nil
+}
+
+func (c *v5Client) Version(ctx context.Context) (string, error) {
+	return c.version, nil
+}
+
+func (c *v5Client) IndexExists(ctx context.Context, name string) (bool, error) {
+	return c.client.IndexExists(name).Do(ctx)
+}
+
+func (c *v5Client) CreateIndex(ctx context.Context, name string, settings map[string]interface{}) error {
+	create := c.client.CreateIndex(name)
+	if settings != nil {
+		create.BodyJson(map[string]interface{}{"settings": settings})
+	}
+	_, err := create.Do(ctx)
+	return err
+}
+
+func (c *v5Client) CreateIndexWithWriteAlias(ctx context.Context, name, alias string, settings map[string]interface{}) error {
+	body := map[string]interface{}{
+		"aliases": map[string]interface{}{
+			alias: map[string]interface{}{"is_write_index": true},
+		},
+	}
+	if settings != nil {
+		body["settings"] = settings
+	}
+	create := c.client.CreateIndex(name)
+	create.BodyJson(body)
+	_, err := create.Do(ctx)
+	return err
+}
+
+func (c *v5Client) Rollover(ctx context.Context, alias string, conditions RolloverConditions) (RolloverResult, error) {
+	res, err := c.client.RolloverIndex(alias).Conditions(conditionsMap(conditions)).Do(ctx)
+	if err != nil {
+		return RolloverResult{}, err
+	}
+	return RolloverResult{RolledOver: res.RolledOver, OldIndex: res.OldIndex, NewIndex: res.NewIndex}, nil
+}
+
+func (c *v5Client) CatIndices(ctx context.Context, pattern string) ([]CatIndex, error) {
+	cat := c.client.CatIndices()
+	cat.Index(pattern)
+	cat.Bytes("b")
+	cat.Columns("index", "status", "pri.store.size")
+	res, err := cat.Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	indexes := make([]CatIndex, 0, len(res))
+	for _, row := range res {
+		indexes = append(indexes, CatIndex{Name: row.Index, Status: row.Status, PriStoreSize: row.PriStoreSize})
+	}
+	return indexes, nil
+}
+
+func (c *v5Client) ApplyAliases(ctx context.Context, actions []AliasAction) error {
+	alias := c.client.Alias()
+	for _, action := range actions {
+		if action.Remove {
+			alias.Remove(action.Index, action.Alias)
+		} else {
+			alias.Add(action.Index, action.Alias)
+		}
+	}
+	_, err := alias.Do(ctx)
+	return err
+}
+
+func (c *v5Client) DeleteIndices(ctx context.Context, names []string) error {
+	_, err := c.client.DeleteIndex(names...).Do(ctx)
+	return err
+}
+
+func (c *v5Client) CloseIndices(ctx context.Context, names []string) error {
+	_, err := c.client.CloseIndex(strings.Join(names, ",")).Do(ctx)
+	return err
+}
+
+func (c *v5Client) FlushIndices(ctx context.Context, names []string) error {
+	_, err := c.client.Flush(names...).Do(ctx)
+	return err
+}
+
+func (c *v5Client) PutSettings(ctx context.Context, names []string, settings map[string]interface{}) error {
+	put := c.client.IndexPutSettings(names...)
+	put.BodyJson(settings)
+	_, err := put.Do(ctx)
+	return err
+}
+
+func (c *v5Client) Forcemerge(ctx context.Context, names []string, maxSegments int) error {
+	merge := c.client.Forcemerge(names...)
+	if maxSegments != 0 {
+		merge.MaxNumSegments(maxSegments)
+	}
+	_, err := merge.Do(ctx)
+	return err
+}
+
+func (c *v5Client) AliasExists(ctx context.Context, index, alias string) (bool, error) {
+	res, err := c.client.Aliases().Index(index).Do(ctx)
+	if err != nil {
+		return false, err
+	}
+	indexResult, ok := res.Indices[index]
+	if !ok {
+		return false, nil
+	}
+	for _, a := range indexResult.Aliases {
+		if a.AliasName == alias {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *v5Client) Shrink(ctx context.Context, source, target string, settings map[string]interface{}) error {
+	shrink := c.client.ShrinkIndex(source, target)
+	if settings != nil {
+		shrink.BodyJson(map[string]interface{}{"settings": settings})
+	}
+	_, err := shrink.Do(ctx)
+	return err
+}
+
+// Freeze always errors: the legacy github.com/olivere/elastic client has no
+// FreezeIndex service (the Freeze API was only exposed starting with
+// olivere/elastic/v7), so there is nothing to call against an ES5/6
+// cluster here. Use an "allocate" action targeting a warm-tier node
+// instead.
+func (c *v5Client) Freeze(ctx context.Context, index string) error {
+	return fmt.Errorf("freeze is not supported against elasticsearch 5.x/6.x (index %q); use allocate to a warm-tier node instead", index)
+}
+
+// Reindex submits source->dest asynchronously via the _reindex API and
+// returns the task id tracking it. See v7Client.Reindex for the meaning of
+// the other ReindexOptions fields; Slices is not passed on by this backend,
+// so 5.x/6.x reindexes run unsliced.
+func (c *v5Client) Reindex(ctx context.Context, source, dest string, opts ReindexOptions) (string, error) {
+	src := elastic.NewReindexSource().Index(source)
+	if opts.Query != nil {
+		queryJSON, err := json.Marshal(opts.Query)
+		if err != nil {
+			return "", err
+		}
+		src = src.Query(elastic.NewRawStringQuery(string(queryJSON)))
+	}
+	destination := elastic.NewReindexDestination().Index(dest)
+	if opts.Pipeline != "" {
+		destination = destination.Pipeline(opts.Pipeline)
+	}
+	reindex := c.client.Reindex().Source(src).Destination(destination).WaitForCompletion(false)
+	if opts.MaxDocs != 0 {
+		reindex = reindex.Size(int(opts.MaxDocs))
+	}
+	res, err := reindex.DoAsync(ctx)
+	if err != nil {
+		return "", err
+	}
+	return res.TaskId, nil
+}
+
+func (c *v5Client) TaskCompleted(ctx context.Context, task string) (bool, error) {
+	res, err := c.client.TasksGetTask().TaskId(task).Do(ctx)
+	if err != nil {
+		return false, err
+	}
+	return res.Completed, nil
+}
+
+func (c *v5Client) SearchConfigs(ctx context.Context, index string) ([]ConfigDoc, error) {
+	res, err := c.client.Search(index).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if res.Hits == nil || res.Hits.TotalHits == 0 {
+		return nil, nil
+	}
+	docs := make([]ConfigDoc, 0, len(res.Hits.Hits))
+	for _, hit := range res.Hits.Hits {
+		docs = append(docs, ConfigDoc{Id: hit.Id, Source: *hit.Source})
+	}
+	return docs, nil
+}
@@ -0,0 +1,236 @@
+package esclient
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	elastic "github.com/olivere/elastic/v7"
+)
+
+// v7Client implements EsClient for Elasticsearch 7.x clusters using
+// olivere/elastic/v7, whose response shapes changed from the v5/v6 client:
+// TotalHits is now a struct and Source is a json.RawMessage value rather
+// than a pointer.
+type v7Client struct {
+	client  *elastic.Client
+	version string
+}
+
+func newV7Client(opts Options, version string) (EsClient, error) {
+	var clientOptions []elastic.ClientOptionFunc
+	if opts.Scheme != "" {
+		clientOptions = append(clientOptions, elastic.SetScheme(opts.Scheme))
+	}
+	if opts.URL != "" {
+		clientOptions = append(clientOptions, elastic.SetURL(opts.URL))
+	}
+	if opts.User != "" {
+		clientOptions = append(clientOptions, elastic.SetBasicAuth(opts.User, opts.Password))
+	}
+	if opts.HTTPClient != nil {
+		clientOptions = append(clientOptions, elastic.SetHttpClient(opts.HTTPClient))
+	}
+	client, err := elastic.NewClient(clientOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return &v7Client{client: client, version: version}, nil
+}
+
+func (c *v7Client) Version(ctx context.Context) (string, error) {
+	return c.version, nil
+}
+
+func (c *v7Client) IndexExists(ctx context.Context, name string) (bool, error) {
+	return c.client.IndexExists(name).Do(ctx)
+}
+
+func (c *v7Client) CreateIndex(ctx context.Context, name string, settings map[string]interface{}) error {
+	create := c.client.CreateIndex(name)
+	if settings != nil {
+		create.BodyJson(map[string]interface{}{"settings": settings})
+	}
+	_, err := create.Do(ctx)
+	return err
+}
+
+func (c *v7Client) CreateIndexWithWriteAlias(ctx context.Context, name, alias string, settings map[string]interface{}) error {
+	body := map[string]interface{}{
+		"aliases": map[string]interface{}{
+			alias: map[string]interface{}{"is_write_index": true},
+		},
+	}
+	if settings != nil {
+		body["settings"] = settings
+	}
+	create := c.client.CreateIndex(name)
+	create.BodyJson(body)
+	_, err := create.Do(ctx)
+	return err
+}
+
+func (c *v7Client) Rollover(ctx context.Context, alias string, conditions RolloverConditions) (RolloverResult, error) {
+	res, err := c.client.RolloverIndex(alias).Conditions(conditionsMap(conditions)).Do(ctx)
+	if err != nil {
+		return RolloverResult{}, err
+	}
+	return RolloverResult{RolledOver: res.RolledOver, OldIndex: res.OldIndex, NewIndex: res.NewIndex}, nil
+}
+
+func (c *v7Client) CatIndices(ctx context.Context, pattern string) ([]CatIndex, error) {
+	cat := c.client.CatIndices()
+	cat.Index(pattern)
+	cat.Bytes("b")
+	cat.Columns("index", "status", "pri.store.size")
+	res, err := cat.Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	indexes := make([]CatIndex, 0, len(res))
+	for _, row := range res {
+		indexes = append(indexes, CatIndex{Name: row.Index, Status: row.Status, PriStoreSize: row.PriStoreSize})
+	}
+	return indexes, nil
+}
+
+func (c *v7Client) ApplyAliases(ctx context.Context, actions []AliasAction) error {
+	alias := c.client.Alias()
+	for _, action := range actions {
+		if action.Remove {
+			alias.Remove(action.Index, action.Alias)
+		} else {
+			alias.Add(action.Index, action.Alias)
+		}
+	}
+	_, err := alias.Do(ctx)
+	return err
+}
+
+func (c *v7Client) DeleteIndices(ctx context.Context, names []string) error {
+	_, err := c.client.DeleteIndex(names...).Do(ctx)
+	return err
+}
+
+func (c *v7Client) CloseIndices(ctx context.Context, names []string) error {
+	_, err := c.client.CloseIndex(strings.Join(names, ",")).Do(ctx)
+	return err
+}
+
+func (c *v7Client) FlushIndices(ctx context.Context, names []string) error {
+	_, err := c.client.Flush(names...).Do(ctx)
+	return err
+}
+
+func (c *v7Client) PutSettings(ctx context.Context, names []string, settings map[string]interface{}) error {
+	put := c.client.IndexPutSettings(names...)
+	put.BodyJson(settings)
+	_, err := put.Do(ctx)
+	return err
+}
+
+// Forcemerge calls _forcemerge, which replaced the _optimize endpoint that
+// Elasticsearch removed in 5.0.
+func (c *v7Client) Forcemerge(ctx context.Context, names []string, maxSegments int) error {
+	merge := c.client.Forcemerge(names...)
+	if maxSegments != 0 {
+		merge.MaxNumSegments(maxSegments)
+	}
+	_, err := merge.Do(ctx)
+	return err
+}
+
+func (c *v7Client) AliasExists(ctx context.Context, index, alias string) (bool, error) {
+	res, err := c.client.Aliases().Index(index).Do(ctx)
+	if err != nil {
+		return false, err
+	}
+	indexResult, ok := res.Indices[index]
+	if !ok {
+		return false, nil
+	}
+	for _, a := range indexResult.Aliases {
+		if a.AliasName == alias {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *v7Client) Shrink(ctx context.Context, source, target string, settings map[string]interface{}) error {
+	shrink := c.client.ShrinkIndex(source, target)
+	if settings != nil {
+		shrink.BodyJson(map[string]interface{}{"settings": settings})
+	}
+	_, err := shrink.Do(ctx)
+	return err
+}
+
+// Freeze marks index as frozen via the Freeze API, which is deprecated from
+// 7.14 onward in favor of data tiers but is still served by 7.x clusters.
+func (c *v7Client) Freeze(ctx context.Context, index string) error {
+	_, err := c.client.FreezeIndex(index).Do(ctx)
+	return err
+}
+
+// Reindex submits source->dest asynchronously via the _reindex API and
+// returns the task id tracking it. MaxDocs limits the source side via
+// Size, Query narrows it to a subset of documents, Pipeline attaches an
+// ingest pipeline to the destination, and Slices ("auto" or a number)
+// parallelizes the copy across slices.
+func (c *v7Client) Reindex(ctx context.Context, source, dest string, opts ReindexOptions) (string, error) {
+	src := elastic.NewReindexSource().Index(source)
+	if opts.Query != nil {
+		queryJSON, err := json.Marshal(opts.Query)
+		if err != nil {
+			return "", err
+		}
+		src = src.Query(elastic.NewRawStringQuery(string(queryJSON)))
+	}
+	destination := elastic.NewReindexDestination().Index(dest)
+	if opts.Pipeline != "" {
+		destination = destination.Pipeline(opts.Pipeline)
+	}
+	reindex := c.client.Reindex().Source(src).Destination(destination).WaitForCompletion(false)
+	if opts.MaxDocs != 0 {
+		reindex = reindex.Size(int(opts.MaxDocs))
+	}
+	if opts.Slices != "" {
+		reindex = reindex.Slices(opts.Slices)
+	}
+	res, err := reindex.DoAsync(ctx)
+	if err != nil {
+		return "", err
+	}
+	return res.TaskId, nil
+}
+
+func (c *v7Client) TaskCompleted(ctx context.Context, task string) (bool, error) {
+	res, err := c.client.TasksGetTask().TaskId(task).Do(ctx)
+	if err != nil {
+		return false, err
+	}
+	return res.Completed, nil
+}
+
+func (c *v7Client) SearchConfigs(ctx context.Context, index string) ([]ConfigDoc, error) {
+	res, err := c.client.Search(index).SeqNoAndPrimaryTerm(true).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if res.Hits == nil || res.Hits.TotalHits == nil || res.Hits.TotalHits.Value == 0 {
+		return nil, nil
+	}
+	docs := make([]ConfigDoc, 0, len(res.Hits.Hits))
+	for _, hit := range res.Hits.Hits {
+		doc := ConfigDoc{Id: hit.Id, Source: hit.Source}
+		if hit.SeqNo != nil {
+			doc.SeqNo = *hit.SeqNo
+		}
+		if hit.PrimaryTerm != nil {
+			doc.PrimaryTerm = *hit.PrimaryTerm
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
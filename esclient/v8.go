@@ -0,0 +1,380 @@
+package esclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	elasticsearch "github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// v8Client implements EsClient for Elasticsearch 8.x clusters using the
+// low-level elastic/go-elasticsearch/v8 REST client. Unlike the v5/v7
+// clients, this library does not build request bodies for us, so each
+// method hand-assembles the JSON esroll has always sent.
+type v8Client struct {
+	client  *elasticsearch.Client
+	version string
+}
+
+func newV8Client(opts Options, version string) (EsClient, error) {
+	cfg := elasticsearch.Config{
+		Addresses: []string{opts.URL},
+		Username:  opts.User,
+		Password:  opts.Password,
+	}
+	if opts.HTTPClient != nil {
+		cfg.Transport = opts.HTTPClient.Transport
+	}
+	client, err := elasticsearch.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &v8Client{client: client, version: version}, nil
+}
+
+func (c *v8Client) Version(ctx context.Context) (string, error) {
+	return c.version, nil
+}
+
+func decodeResponse(res *esapi.Response, out interface{}) error {
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return fmt.Errorf("elasticsearch error: %s", string(body))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
+
+func (c *v8Client) IndexExists(ctx context.Context, name string) (bool, error) {
+	res, err := c.client.Indices.Exists([]string{name}, c.client.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	return res.StatusCode == 200, nil
+}
+
+func (c *v8Client) CreateIndex(ctx context.Context, name string, settings map[string]interface{}) error {
+	var body bytes.Buffer
+	if settings != nil {
+		if err := json.NewEncoder(&body).Encode(map[string]interface{}{"settings": settings}); err != nil {
+			return err
+		}
+	}
+	req := c.client.Indices.Create.WithContext(ctx)
+	opts := []func(*esapi.IndicesCreateRequest){req}
+	if body.Len() > 0 {
+		opts = append(opts, c.client.Indices.Create.WithBody(&body))
+	}
+	res, err := c.client.Indices.Create(name, opts...)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(res, nil)
+}
+
+func (c *v8Client) CreateIndexWithWriteAlias(ctx context.Context, name, alias string, settings map[string]interface{}) error {
+	body := map[string]interface{}{
+		"aliases": map[string]interface{}{
+			alias: map[string]interface{}{"is_write_index": true},
+		},
+	}
+	if settings != nil {
+		body["settings"] = settings
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return err
+	}
+	res, err := c.client.Indices.Create(
+		name,
+		c.client.Indices.Create.WithContext(ctx),
+		c.client.Indices.Create.WithBody(&buf),
+	)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(res, nil)
+}
+
+type rolloverResponse struct {
+	RolledOver bool   `json:"rolled_over"`
+	OldIndex   string `json:"old_index"`
+	NewIndex   string `json:"new_index"`
+}
+
+func (c *v8Client) Rollover(ctx context.Context, alias string, conditions RolloverConditions) (RolloverResult, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{"conditions": conditionsMap(conditions)}); err != nil {
+		return RolloverResult{}, err
+	}
+	res, err := c.client.Indices.Rollover(
+		alias,
+		c.client.Indices.Rollover.WithContext(ctx),
+		c.client.Indices.Rollover.WithBody(&buf),
+	)
+	if err != nil {
+		return RolloverResult{}, err
+	}
+	var parsed rolloverResponse
+	if err := decodeResponse(res, &parsed); err != nil {
+		return RolloverResult{}, err
+	}
+	return RolloverResult{RolledOver: parsed.RolledOver, OldIndex: parsed.OldIndex, NewIndex: parsed.NewIndex}, nil
+}
+
+func (c *v8Client) AliasExists(ctx context.Context, index, alias string) (bool, error) {
+	res, err := c.client.Indices.ExistsAlias(
+		[]string{alias},
+		c.client.Indices.ExistsAlias.WithContext(ctx),
+		c.client.Indices.ExistsAlias.WithIndex(index),
+	)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	return res.StatusCode == 200, nil
+}
+
+func (c *v8Client) Shrink(ctx context.Context, source, target string, settings map[string]interface{}) error {
+	var buf bytes.Buffer
+	if settings != nil {
+		if err := json.NewEncoder(&buf).Encode(map[string]interface{}{"settings": settings}); err != nil {
+			return err
+		}
+	}
+	opts := []func(*esapi.IndicesShrinkRequest){c.client.Indices.Shrink.WithContext(ctx)}
+	if buf.Len() > 0 {
+		opts = append(opts, c.client.Indices.Shrink.WithBody(&buf))
+	}
+	res, err := c.client.Indices.Shrink(source, target, opts...)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(res, nil)
+}
+
+// Freeze always errors: the Freeze API was removed from Elasticsearch 8.x in
+// favor of data tiers and searchable snapshots, so there is no equivalent
+// call to make here. Use an "allocate" action targeting a cold/frozen tier
+// instead.
+func (c *v8Client) Freeze(ctx context.Context, index string) error {
+	return fmt.Errorf("freeze is not supported on elasticsearch 8.x (index %q); use allocate to a frozen-tier node instead", index)
+}
+
+type catIndexRow struct {
+	Index        string `json:"index"`
+	Status       string `json:"status"`
+	PriStoreSize string `json:"pri.store.size"`
+}
+
+func (c *v8Client) CatIndices(ctx context.Context, pattern string) ([]CatIndex, error) {
+	res, err := c.client.Cat.Indices(
+		c.client.Cat.Indices.WithContext(ctx),
+		c.client.Cat.Indices.WithIndex(pattern),
+		c.client.Cat.Indices.WithBytes("b"),
+		c.client.Cat.Indices.WithH("index", "status", "pri.store.size"),
+		c.client.Cat.Indices.WithFormat("json"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var rows []catIndexRow
+	if err := decodeResponse(res, &rows); err != nil {
+		return nil, err
+	}
+	indexes := make([]CatIndex, 0, len(rows))
+	for _, row := range rows {
+		indexes = append(indexes, CatIndex{Name: row.Index, Status: row.Status, PriStoreSize: row.PriStoreSize})
+	}
+	return indexes, nil
+}
+
+func (c *v8Client) ApplyAliases(ctx context.Context, actions []AliasAction) error {
+	type aliasStep struct {
+		Index string `json:"index"`
+		Alias string `json:"alias"`
+	}
+	body := map[string]interface{}{}
+	var steps []map[string]aliasStep
+	for _, action := range actions {
+		if action.Remove {
+			steps = append(steps, map[string]aliasStep{"remove": {Index: action.Index, Alias: action.Alias}})
+		} else {
+			steps = append(steps, map[string]aliasStep{"add": {Index: action.Index, Alias: action.Alias}})
+		}
+	}
+	body["actions"] = steps
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return err
+	}
+	res, err := c.client.Indices.UpdateAliases(&buf, c.client.Indices.UpdateAliases.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	return decodeResponse(res, nil)
+}
+
+func (c *v8Client) DeleteIndices(ctx context.Context, names []string) error {
+	res, err := c.client.Indices.Delete(names, c.client.Indices.Delete.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	return decodeResponse(res, nil)
+}
+
+func (c *v8Client) CloseIndices(ctx context.Context, names []string) error {
+	res, err := c.client.Indices.Close(names, c.client.Indices.Close.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	return decodeResponse(res, nil)
+}
+
+func (c *v8Client) FlushIndices(ctx context.Context, names []string) error {
+	res, err := c.client.Indices.Flush(
+		c.client.Indices.Flush.WithContext(ctx),
+		c.client.Indices.Flush.WithIndex(names...),
+	)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(res, nil)
+}
+
+func (c *v8Client) PutSettings(ctx context.Context, names []string, settings map[string]interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(settings); err != nil {
+		return err
+	}
+	res, err := c.client.Indices.PutSettings(
+		&buf,
+		c.client.Indices.PutSettings.WithContext(ctx),
+		c.client.Indices.PutSettings.WithIndex(names...),
+	)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(res, nil)
+}
+
+// Forcemerge calls _forcemerge via the Indices.Forcemerge API, the same
+// endpoint the v7 client speaks; _optimize is gone entirely by 8.x.
+func (c *v8Client) Forcemerge(ctx context.Context, names []string, maxSegments int) error {
+	opts := []func(*esapi.IndicesForcemergeRequest){
+		c.client.Indices.Forcemerge.WithContext(ctx),
+		c.client.Indices.Forcemerge.WithIndex(names...),
+	}
+	if maxSegments != 0 {
+		opts = append(opts, c.client.Indices.Forcemerge.WithMaxNumSegments(maxSegments))
+	}
+	res, err := c.client.Indices.Forcemerge(opts...)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(res, nil)
+}
+
+func (c *v8Client) Reindex(ctx context.Context, source, dest string, opts ReindexOptions) (string, error) {
+	src := map[string]interface{}{"index": source}
+	if opts.Query != nil {
+		src["query"] = opts.Query
+	}
+	dst := map[string]interface{}{"index": dest}
+	if opts.Pipeline != "" {
+		dst["pipeline"] = opts.Pipeline
+	}
+	body := map[string]interface{}{"source": src, "dest": dst}
+	if opts.MaxDocs != 0 {
+		body["max_docs"] = opts.MaxDocs
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return "", err
+	}
+	reqOpts := []func(*esapi.ReindexRequest){
+		c.client.Reindex.WithContext(ctx),
+		c.client.Reindex.WithWaitForCompletion(false),
+	}
+	// Note: esapi's ReindexRequest does not expose a WithSlices option that
+	// accepts "auto", so the slices hint is honored by the v7 backend only;
+	// 8.x reindexes run unsliced here.
+	res, err := c.client.Reindex(&buf, reqOpts...)
+	if err != nil {
+		return "", err
+	}
+	var parsed struct {
+		Task string `json:"task"`
+	}
+	if err := decodeResponse(res, &parsed); err != nil {
+		return "", err
+	}
+	return parsed.Task, nil
+}
+
+func (c *v8Client) TaskCompleted(ctx context.Context, task string) (bool, error) {
+	res, err := c.client.Tasks.Get(task, c.client.Tasks.Get.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	var parsed struct {
+		Completed bool `json:"completed"`
+	}
+	if err := decodeResponse(res, &parsed); err != nil {
+		return false, err
+	}
+	return parsed.Completed, nil
+}
+
+type v8SearchResponse struct {
+	Hits struct {
+		Total struct {
+			Value int64 `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			Id          string          `json:"_id"`
+			Source      json.RawMessage `json:"_source"`
+			SeqNo       int64           `json:"_seq_no"`
+			PrimaryTerm int64           `json:"_primary_term"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+func (c *v8Client) SearchConfigs(ctx context.Context, index string) ([]ConfigDoc, error) {
+	res, err := c.client.Search(
+		c.client.Search.WithContext(ctx),
+		c.client.Search.WithIndex(index),
+		c.client.Search.WithSeqNoPrimaryTerm(true),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var parsed v8SearchResponse
+	if err := decodeResponse(res, &parsed); err != nil {
+		return nil, err
+	}
+	if parsed.Hits.Total.Value == 0 {
+		return nil, nil
+	}
+	docs := make([]ConfigDoc, 0, len(parsed.Hits.Hits))
+	for _, hit := range parsed.Hits.Hits {
+		docs = append(docs, ConfigDoc{
+			Id:          hit.Id,
+			Source:      []byte(hit.Source),
+			SeqNo:       hit.SeqNo,
+			PrimaryTerm: hit.PrimaryTerm,
+		})
+	}
+	return docs, nil
+}
@@ -8,17 +8,22 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	awssdk "github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/dustin/go-humanize"
-	"github.com/olivere/elastic"
 	aws "github.com/olivere/elastic/aws/v4"
+	"github.com/rwynn/esroll/esclient"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -32,8 +37,27 @@ var rollUnits = map[string]bool{
 	"years":   true,
 }
 
+var phaseActionTypes = map[string]bool{
+	"forceMerge": true,
+	"shrink":     true,
+	"allocate":   true,
+	"freeze":     true,
+	"readonly":   true,
+	"close":      true,
+	"delete":     true,
+}
+
 const Version string = "1.3.0"
 
+// reindexMaxPollAttempts and reindexMaxBackoff bound how long Roll will wait
+// on an OnRoll.Reindex task before giving up; a reindex that is still
+// running after that long is surfaced as an error rather than blocking the
+// roll loop indefinitely. reindexSleep is a var so tests can replace it with
+// a no-op and shrink the wait to nothing.
+var reindexMaxPollAttempts = 40
+var reindexMaxBackoff = 30 * time.Second
+var reindexSleep = time.Sleep
+
 const ExampleConfig string = `curl -XPUT -H'Content-Type:application/json' localhost:9200/esroll/config/snowball -d '{
 	"targetIndex": "snowball",
 	"rollUnit": "minutes",
@@ -59,15 +83,18 @@ func (a ByIndexAge) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByIndexAge) Less(i, j int) bool { return a[i].Name < a[j].Name }
 
 type EsRollConfig struct {
-	ElasticUrl      string
-	ElasticUser     string
-	ElasticPassword string
-	ElasticPemFile  string
-	Insecure        bool
-	AWSAccessKey    string
-	AWSSecretKey    string
-	AWSRegion       string
-	Daemon          bool
+	ElasticUrl              string
+	ElasticUser             string
+	ElasticPassword         string
+	ElasticPemFile          string
+	Insecure                bool
+	AWSAccessKey            string
+	AWSSecretKey            string
+	AWSRegion               string
+	AWSProfile              string
+	AWSRoleArn              string
+	AWSWebIdentityTokenFile string
+	Daemon                  bool
 }
 
 type Index struct {
@@ -84,33 +111,89 @@ type IndexConfig struct {
 	RollIncrement           int                    `json:"rollIncrement"`
 	RollUnit                string                 `json:"rollUnit"`
 	RollSize                string                 `json:"rollSize",omitempty`
+	RollMode                string                 `json:"rollMode",omitempty`
+	Rollover                *RolloverConfig        `json:"rollover",omitempty`
 	IndexesToAliasForSearch int                    `json:"searchAliases",omitempty`
 	SearchSuffix            string                 `json:"searchSuffix",omitempty`
 	DeleteOldIndexes        bool                   `json:"deleteOld",omitempty`
 	CloseOldIndexes         bool                   `json:"closeOld",omitempty`
 	OptimizeOnRoll          bool                   `json:"optimizeOnRoll",omitempty`
 	OptimizeMaxSegments     int                    `json:"optimizeMaxSegments",omitempty`
+	Phases                  []Phase                `json:"phases",omitempty`
+	OnRoll                  *OnRollConfig          `json:"onRoll",omitempty`
+}
+
+// OnRollConfig groups actions esroll takes as part of rolling to a new
+// index, beyond simply creating it and flipping aliases.
+type OnRollConfig struct {
+	Reindex *ReindexOnRollConfig `json:"reindex",omitempty`
+}
+
+// ReindexOnRollConfig copies documents from the previous index into the new
+// one before the write alias is flipped to it, so that mapping/template
+// changes (e.g. a new runtime field) can be backfilled without an outage.
+// MaxDocs caps how many documents are copied and Query narrows the copy to
+// matching documents; both may be set together, and leaving both unset
+// copies everything. No sort is applied, so which documents a MaxDocs cap
+// keeps is not defined; it does not select the most recent ones. Pipeline
+// names an ingest pipeline to transform documents in flight, and Slices
+// ("auto" or a number) parallelizes the copy on the ES 7.x backend only.
+type ReindexOnRollConfig struct {
+	MaxDocs  int64                  `json:"maxDocs",omitempty`
+	Query    map[string]interface{} `json:"query",omitempty`
+	Pipeline string                 `json:"pipeline",omitempty`
+	Slices   string                 `json:"slices",omitempty`
+}
+
+// Phase is one step of an ILM-style tiered storage policy, e.g. warm or
+// cold. An index enters a phase once it has been rolled AfterRolls times
+// (if set) or reached AfterAge (if set), at which point its Actions run
+// exactly once.
+type Phase struct {
+	Name       string        `json:"name"`
+	AfterRolls int           `json:"afterRolls",omitempty`
+	AfterAge   string        `json:"afterAge",omitempty`
+	Actions    []PhaseAction `json:"actions"`
+}
+
+// PhaseAction is a single tiered storage action: one of forceMerge, shrink,
+// allocate, freeze, readonly, close, or delete.
+type PhaseAction struct {
+	Type             string            `json:"type"`
+	MaxSegments      int               `json:"maxSegments",omitempty`
+	NumberOfShards   int               `json:"numberOfShards",omitempty`
+	RequireAttrs     map[string]string `json:"requireAttrs",omitempty`
+	IncludeAttrs     map[string]string `json:"includeAttrs",omitempty`
+	NumberOfReplicas *int              `json:"numberOfReplicas",omitempty`
+}
+
+// RolloverConfig carries the conditions esroll passes to the Elasticsearch
+// Rollover API when IndexConfig.RollMode is "rollover". At least one
+// condition must be set; the cluster rolls over as soon as any is met.
+type RolloverConfig struct {
+	MaxAge  string `json:"maxAge",omitempty`
+	MaxDocs int64  `json:"maxDocs",omitempty`
+	MaxSize string `json:"maxSize",omitempty`
 }
 
-func GetConfigs(client *elastic.Client) (Configs, error) {
-	search := client.Search("esroll")
-	res, err := search.Do(context.Background())
+func GetConfigs(client esclient.EsClient) (Configs, error) {
+	docs, err := client.SearchConfigs(context.Background(), "esroll")
 	if err != nil {
 		return nil, err
 	}
-	if res.Hits.TotalHits == 0 {
+	if len(docs) == 0 {
 		return nil, errors.New("configuration documents not found")
 	}
 	var configs Configs
-	for _, hit := range res.Hits.Hits {
+	for _, doc := range docs {
 		var configData IndexConfig
-		if err := json.Unmarshal(*hit.Source, &configData); err != nil {
+		if err := json.Unmarshal(doc.Source, &configData); err != nil {
 			return nil, err
 		}
-		configData.Id = hit.Id
+		configData.Id = doc.Id
 		configData.SetDefaults()
 		if err := configData.Validate(); err != nil {
-			log.Println(err)
+			logger.Error("invalid config", "config", configData.Id, "error", err)
 		} else {
 			configs = append(configs, configData)
 		}
@@ -125,6 +208,21 @@ func (config *IndexConfig) Validate() error {
 	if config.IndexesToAliasForSearch < 0 {
 		return errors.New("searchIndexes must be greater than or equal to 0")
 	}
+	if config.RollsOnRollover() {
+		if config.Rollover == nil {
+			return errors.New("configuration id[" + config.Id + "] is invalid. rollover conditions are required when rollMode is rollover.")
+		}
+		if config.Rollover.MaxAge == "" && config.Rollover.MaxDocs == 0 && config.Rollover.MaxSize == "" {
+			return errors.New("configuration id[" + config.Id + "] is invalid. rollover requires at least one of maxAge, maxDocs, or maxSize.")
+		}
+		if config.OptimizeMaxSegments < 0 {
+			return errors.New("optimizeMaxSegments must be greater than or equal to 0")
+		}
+		if len(config.Phases) > 0 || config.OnRoll != nil || config.SettingsOnRoll != nil || config.OptimizeOnRoll || config.DeleteOldIndexes || config.CloseOldIndexes {
+			return errors.New("configuration id[" + config.Id + "] is invalid. phases, onRoll, settingsOnRoll, optimizeOnRoll, deleteOld, and closeOld are not supported when rollMode is rollover; rolloverRoll only creates the next generation and flips the write alias, since the Rollover API's own naming (TargetIndex-000001) is not one ApplyPhases/OldIndexNames can discover.")
+		}
+		return nil
+	}
 	if config.RollUnit == "" {
 		return errors.New("configuration id[" + config.Id + "] is invalid. rollUnit is required.")
 	} else if rollUnits[config.RollUnit] == false {
@@ -145,6 +243,39 @@ func (config *IndexConfig) Validate() error {
 			}
 		}
 	}
+	for _, phase := range config.Phases {
+		if err := phase.Validate(config.Id); err != nil {
+			return err
+		}
+	}
+	if config.OnRoll != nil && config.OnRoll.Reindex != nil {
+		reindex := config.OnRoll.Reindex
+		if reindex.MaxDocs < 0 {
+			return errors.New("configuration id[" + config.Id + "] is invalid. onRoll.reindex.maxDocs must be greater than or equal to 0.")
+		}
+		if reindex.Slices != "" && reindex.Slices != "auto" {
+			if n, err := strconv.Atoi(reindex.Slices); err != nil || n <= 0 {
+				return errors.New("configuration id[" + config.Id + "] is invalid. onRoll.reindex.slices must be \"auto\" or a positive number.")
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks that phase has a name, a trigger, and only known action
+// types, returning an error that identifies the owning config by id.
+func (phase *Phase) Validate(configId string) error {
+	if phase.Name == "" {
+		return errors.New("configuration id[" + configId + "] is invalid. every phase requires a name.")
+	}
+	if phase.AfterRolls <= 0 && phase.AfterAge == "" {
+		return errors.New("configuration id[" + configId + "] is invalid. phase[" + phase.Name + "] requires afterRolls or afterAge.")
+	}
+	for _, action := range phase.Actions {
+		if !phaseActionTypes[action.Type] {
+			return errors.New("configuration id[" + configId + "] is invalid. phase[" + phase.Name + "] has unknown action type: " + action.Type)
+		}
+	}
 	return nil
 }
 
@@ -181,11 +312,15 @@ func (config *IndexConfig) NextIndex(t time.Time) string {
 	return config.TargetIndex + "_" + suffix
 }
 
-func (config *IndexConfig) IndexSize(client *elastic.Client) (int64, error) {
-	cat := client.CatIndices()
-	cat.Index(config.TargetIndex)
-	cat.Bytes("b")
-	res, err := cat.Do(context.Background())
+// InitialRolloverIndex is the first index created behind a rollover alias,
+// using the "-000001" suffix convention the Rollover API expects so that it
+// can compute subsequent generations itself.
+func (config *IndexConfig) InitialRolloverIndex() string {
+	return config.TargetIndex + "-000001"
+}
+
+func (config *IndexConfig) IndexSize(client esclient.EsClient) (int64, error) {
+	res, err := client.CatIndices(context.Background(), config.TargetIndex)
 	if err != nil {
 		return 0, err
 	}
@@ -204,9 +339,8 @@ func (config *IndexConfig) IndexSize(client *elastic.Client) (int64, error) {
 	}
 }
 
-func (config *IndexConfig) HasRoom(client *elastic.Client) (bool, error) {
-	exists := client.IndexExists(config.TargetIndex)
-	ok, _ := exists.Do(context.Background())
+func (config *IndexConfig) HasRoom(client esclient.EsClient) (bool, error) {
+	ok, _ := client.IndexExists(context.Background(), config.TargetIndex)
 	if !ok {
 		return false, nil
 	} else {
@@ -225,7 +359,35 @@ func (config *IndexConfig) HasRoom(client *elastic.Client) (bool, error) {
 	}
 }
 
-func (config *IndexConfig) Roll(client *elastic.Client, t time.Time) error {
+// rollsInFlight tracks which config ids currently have a rollAndRecord
+// goroutine running, so a slow roll (e.g. one waiting on an OnRoll.Reindex
+// task) can't be started again for the same config before it finishes.
+// Without this, overlapping sizeTicker ticks or a workQ tick landing mid-roll
+// could launch duplicate CreateIndex/reindex/alias-flip sequences against
+// the same previous index.
+var rollsInFlight sync.Map
+
+// rollAndRecord runs conf.Roll and records its outcome the same way
+// recordRoll always has, but is meant to be called via `go` from the
+// daemon's select loop: a Roll that is waiting on an OnRoll.Reindex task can
+// run for as long as the copy takes, and must not block the loop's handling
+// of every other config's scheduled rolls, size checks, or health pings.
+func rollAndRecord(conf IndexConfig, client esclient.EsClient, t time.Time) {
+	if _, alreadyRunning := rollsInFlight.LoadOrStore(conf.Id, struct{}{}); alreadyRunning {
+		logger.Warn("skipped roll already in progress", "config", conf.Id)
+		return
+	}
+	defer rollsInFlight.Delete(conf.Id)
+	start := time.Now()
+	err := conf.Roll(client, t)
+	recordRoll(conf, start, err)
+}
+
+func (config *IndexConfig) Roll(client esclient.EsClient, t time.Time) error {
+	if config.RollsOnRollover() {
+		return config.rolloverRoll(client)
+	}
+	ctx := context.Background()
 	nextIndex := config.NextIndex(t)
 	if config.RollsOnSize() {
 		room, err := config.HasRoom(client)
@@ -235,33 +397,32 @@ func (config *IndexConfig) Roll(client *elastic.Client, t time.Time) error {
 			return nil
 		}
 	} else {
-		exists := client.IndexExists(nextIndex)
-		ok, _ := exists.Do(context.Background())
+		ok, _ := client.IndexExists(ctx, nextIndex)
 		if ok {
 			return nil
 		}
 	}
-	settings := make(map[string]interface{})
-	if config.Settings != nil {
-		settings["settings"] = config.Settings
-	}
 	oldIndexes := config.OldIndexNames(client)
-	createIndex := client.CreateIndex(nextIndex)
-	createIndex.BodyJson(settings)
-	if _, err := createIndex.Do(context.Background()); err != nil {
+	if err := client.CreateIndex(ctx, nextIndex, config.Settings); err != nil {
 		return err
 	}
-	alias := client.Alias()
+	if config.OnRoll != nil && config.OnRoll.Reindex != nil && len(oldIndexes) > 0 {
+		previousIndex := oldIndexes[len(oldIndexes)-1].Name
+		if err := config.reindexOnRoll(client, previousIndex, nextIndex); err != nil {
+			return err
+		}
+	}
+	var aliases []esclient.AliasAction
 	var cleanup, optimizes []string
 	var searchSuffix string = "_" + config.SearchSuffix
-	alias.Add(nextIndex, config.TargetIndex)
-	alias.Add(nextIndex, config.TargetIndex+searchSuffix)
+	aliases = append(aliases, esclient.AliasAction{Index: nextIndex, Alias: config.TargetIndex})
+	aliases = append(aliases, esclient.AliasAction{Index: nextIndex, Alias: config.TargetIndex + searchSuffix})
 	searchIndexes := 1 + len(oldIndexes)
 	for i, oldIndex := range oldIndexes {
-		alias.Remove(oldIndex.Name, config.TargetIndex)
+		aliases = append(aliases, esclient.AliasAction{Index: oldIndex.Name, Alias: config.TargetIndex, Remove: true})
 		retire := (searchIndexes - 1) >= config.IndexesToAliasForSearch
 		if retire {
-			alias.Remove(oldIndex.Name, config.TargetIndex+searchSuffix)
+			aliases = append(aliases, esclient.AliasAction{Index: oldIndex.Name, Alias: config.TargetIndex + searchSuffix, Remove: true})
 			searchIndexes = searchIndexes - 1
 			if config.DeleteOldIndexes {
 				cleanup = append(cleanup, oldIndex.Name)
@@ -274,54 +435,263 @@ func (config *IndexConfig) Roll(client *elastic.Client, t time.Time) error {
 			}
 		}
 	}
-	if _, err := alias.Do(context.Background()); err != nil {
+	if err := client.ApplyAliases(ctx, aliases); err != nil {
 		return err
 	}
 	if len(cleanup) > 0 {
 		if config.DeleteOldIndexes {
-			del := client.DeleteIndex(cleanup...)
-			if _, err := del.Do(context.Background()); err != nil {
+			if err := client.DeleteIndices(ctx, cleanup); err != nil {
 				return err
 			}
 		} else if config.CloseOldIndexes {
-			flush := client.Flush(cleanup...)
-			if _, err := flush.Do(context.Background()); err != nil {
+			if err := client.FlushIndices(ctx, cleanup); err != nil {
 				return err
 			}
-			cls := client.CloseIndex(strings.Join(cleanup, ","))
-			if _, err := cls.Do(context.Background()); err != nil {
+			if err := client.CloseIndices(ctx, cleanup); err != nil {
 				return err
 			}
 		}
 	}
 	if len(optimizes) > 0 {
 		if config.SettingsOnRoll != nil {
-			settings := client.IndexPutSettings(optimizes...)
-			settings.BodyJson(config.SettingsOnRoll)
-			if _, err := settings.Do(context.Background()); err != nil {
+			if err := client.PutSettings(ctx, optimizes, config.SettingsOnRoll); err != nil {
 				return err
 			}
 		}
 		if config.OptimizeOnRoll {
-			merge := client.Forcemerge(optimizes...)
-			if config.OptimizeMaxSegments != 0 {
-				merge.MaxNumSegments(config.OptimizeMaxSegments)
+			mergeStart := time.Now()
+			err := client.Forcemerge(ctx, optimizes, config.OptimizeMaxSegments)
+			forcemergeDuration.WithLabelValues(config.Id).Observe(time.Since(mergeStart).Seconds())
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if len(config.Phases) > 0 {
+		if err := config.ApplyPhases(client, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyPhases walks every existing TargetIndex_* index, works out which
+// phase (if any) it has reached based on roll count and age, and applies
+// that phase's actions once. Already-applied phases are skipped by checking
+// for a marker alias, so repeated calls are safe.
+func (config *IndexConfig) ApplyPhases(client esclient.EsClient, t time.Time) error {
+	ctx := context.Background()
+	oldIndexes := config.OldIndexNames(client)
+	for i, oldIndex := range oldIndexes {
+		rollsSince := len(oldIndexes) - i
+		age := config.indexAge(oldIndex.Name, t)
+		for _, phase := range config.Phases {
+			if !phase.reached(rollsSince, age) {
+				continue
+			}
+			marker := phaseMarker(oldIndex.Name, phase.Name)
+			applied, err := client.AliasExists(ctx, oldIndex.Name, marker)
+			if err != nil {
+				return err
+			}
+			if applied {
+				continue
+			}
+			if err := config.applyPhaseActions(client, oldIndex.Name, phase); err != nil {
+				return err
+			}
+			if phase.deletes() {
+				// The index is gone, so there is nothing left to alias a
+				// marker onto - and nothing left for a later phase on this
+				// same index to act on either.
+				break
+			}
+			if err := client.ApplyAliases(ctx, []esclient.AliasAction{{Index: oldIndex.Name, Alias: marker}}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deletes reports whether phase includes a delete action, which removes the
+// index entirely rather than merely changing its settings or allocation.
+func (phase *Phase) deletes() bool {
+	for _, action := range phase.Actions {
+		if action.Type == "delete" {
+			return true
+		}
+	}
+	return false
+}
+
+// reindexOnRoll copies documents from previousIndex into nextIndex per
+// config.OnRoll.Reindex before Roll flips the write alias, so that queries
+// and writes against the old index keep working undisturbed until the copy
+// (and the subsequent alias flip) has completed. It submits the _reindex
+// asynchronously and polls the resulting task with exponential backoff,
+// since a copy covering many documents can take far longer than esroll's
+// own roll cadence.
+func (config *IndexConfig) reindexOnRoll(client esclient.EsClient, previousIndex, nextIndex string) error {
+	ctx := context.Background()
+	reindex := config.OnRoll.Reindex
+	task, err := client.Reindex(ctx, previousIndex, nextIndex, esclient.ReindexOptions{
+		MaxDocs:  reindex.MaxDocs,
+		Query:    reindex.Query,
+		Pipeline: reindex.Pipeline,
+		Slices:   reindex.Slices,
+	})
+	if err != nil {
+		return err
+	}
+	backoff := time.Second
+	for attempt := 0; attempt < reindexMaxPollAttempts; attempt++ {
+		done, err := client.TaskCompleted(ctx, task)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		reindexSleep(backoff)
+		if backoff < reindexMaxBackoff {
+			backoff *= 2
+		}
+	}
+	return errors.New("configuration id[" + config.Id + "] reindex onRoll did not complete after " + strconv.Itoa(reindexMaxPollAttempts) + " polls")
+}
+
+func phaseMarker(index, phaseName string) string {
+	return index + "_phase_" + phaseName
+}
+
+// reached reports whether an index that has been rolled rollsSince times
+// and is age old has met this phase's trigger.
+func (phase *Phase) reached(rollsSince int, age time.Duration) bool {
+	if phase.AfterRolls > 0 && rollsSince >= phase.AfterRolls {
+		return true
+	}
+	if phase.AfterAge != "" {
+		if d, err := parsePhaseAge(phase.AfterAge); err == nil && age >= d {
+			return true
+		}
+	}
+	return false
+}
+
+// indexAge estimates how long ago indexName was created by parsing its roll
+// suffix with the same layout NextIndex used to create it.
+func (config *IndexConfig) indexAge(indexName string, now time.Time) time.Duration {
+	suffix := strings.TrimPrefix(indexName, config.TargetIndex+"_")
+	created, err := time.Parse(config.IndexSuffixFormat(), suffix)
+	if err != nil {
+		return 0
+	}
+	return now.Sub(created)
+}
+
+// parsePhaseAge parses durations like "30d" in addition to anything
+// time.ParseDuration already understands, since Elasticsearch's own age
+// conditions are commonly expressed in days.
+func parsePhaseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func (config *IndexConfig) applyPhaseActions(client esclient.EsClient, index string, phase Phase) error {
+	ctx := context.Background()
+	for _, action := range phase.Actions {
+		switch action.Type {
+		case "forceMerge":
+			if err := client.Forcemerge(ctx, []string{index}, action.MaxSegments); err != nil {
+				return err
+			}
+		case "shrink":
+			settings := make(map[string]interface{})
+			if action.NumberOfShards != 0 {
+				settings["index.number_of_shards"] = action.NumberOfShards
+			}
+			if err := client.Shrink(ctx, index, index+"_shrunk", settings); err != nil {
+				return err
+			}
+		case "allocate":
+			settings := make(map[string]interface{})
+			for k, v := range action.RequireAttrs {
+				settings["index.routing.allocation.require."+k] = v
+			}
+			for k, v := range action.IncludeAttrs {
+				settings["index.routing.allocation.include."+k] = v
 			}
-			if _, err := merge.Do(context.Background()); err != nil {
+			if action.NumberOfReplicas != nil {
+				settings["index.number_of_replicas"] = *action.NumberOfReplicas
+			}
+			if len(settings) > 0 {
+				if err := client.PutSettings(ctx, []string{index}, settings); err != nil {
+					return err
+				}
+			}
+		case "freeze":
+			if err := client.Freeze(ctx, index); err != nil {
+				return err
+			}
+		case "readonly":
+			if err := client.PutSettings(ctx, []string{index}, map[string]interface{}{"index.blocks.write": true}); err != nil {
 				return err
 			}
+		case "close":
+			if err := client.CloseIndices(ctx, []string{index}); err != nil {
+				return err
+			}
+		case "delete":
+			if err := client.DeleteIndices(ctx, []string{index}); err != nil {
+				return err
+			}
+		default:
+			return errors.New("unknown phase action type: " + action.Type)
 		}
 	}
 	return nil
 }
 
+// rolloverRoll handles RollMode "rollover": on first run it bootstraps
+// TargetIndex as a write alias pointing at an initial "-000001" index, and
+// on every later call it asks the cluster to roll over against that alias,
+// letting Elasticsearch decide when the configured conditions are met.
+func (config *IndexConfig) rolloverRoll(client esclient.EsClient) error {
+	ctx := context.Background()
+	bootstrapped, _ := client.IndexExists(ctx, config.TargetIndex)
+	if !bootstrapped {
+		return client.CreateIndexWithWriteAlias(ctx, config.InitialRolloverIndex(), config.TargetIndex, config.Settings)
+	}
+	conditions := esclient.RolloverConditions{}
+	if config.Rollover != nil {
+		conditions.MaxAge = config.Rollover.MaxAge
+		conditions.MaxDocs = config.Rollover.MaxDocs
+		conditions.MaxSize = config.Rollover.MaxSize
+	}
+	_, err := client.Rollover(ctx, config.TargetIndex, conditions)
+	return err
+}
+
 func (config *IndexConfig) RollsOnSize() bool {
 	return config.RollUnit == "bytes"
 }
 
+// RollsOnRollover reports whether this config delegates roll decisions to
+// the Elasticsearch Rollover API instead of esroll's own tick/size checks.
+func (config *IndexConfig) RollsOnRollover() bool {
+	return config.RollMode == "rollover"
+}
+
 func (config *IndexConfig) ShouldRoll(t time.Time) bool {
 	var roll bool = false
-	if config.RollsOnSize() {
+	if config.RollsOnSize() || config.RollsOnRollover() {
 		return false
 	} else if config.RollUnit == "minutes" {
 		roll = t.Second() == 0
@@ -348,15 +718,12 @@ func (config *IndexConfig) ShouldRoll(t time.Time) bool {
 	return roll
 }
 
-func (config *IndexConfig) OldIndexNames(client *elastic.Client) []Index {
-	cat := client.CatIndices()
-	cat.Index(config.TargetIndex + "_*")
-	cat.Columns("index", "status")
-	res, err := cat.Do(context.Background())
+func (config *IndexConfig) OldIndexNames(client esclient.EsClient) []Index {
+	res, err := client.CatIndices(context.Background(), config.TargetIndex+"_*")
 	var indexes []Index
 	if err == nil {
 		for _, i := range res {
-			indexes = append(indexes, Index{Name: i.Index, Status: i.Status})
+			indexes = append(indexes, Index{Name: i.Name, Status: i.Status})
 		}
 		sort.Sort(ByIndexAge(indexes))
 	}
@@ -390,16 +757,78 @@ func (config *EsRollConfig) NewHTTPClient() (client *http.Client, err error) {
 	client = &http.Client{
 		Transport: transport,
 	}
-	if config.AWSAccessKey != "" {
-		client = aws.NewV4SigningClientWithHTTPClient(credentials.NewStaticCredentials(
-			config.AWSAccessKey,
-			config.AWSSecretKey,
-			"",
-		), config.AWSRegion, client)
+	if config.needsAWSSigning() {
+		creds, region, credsErr := config.awsCredentials()
+		if credsErr != nil {
+			return client, credsErr
+		}
+		client = aws.NewV4SigningClientWithHTTPClient(creds, region, client)
 	}
 	return client, err
 }
 
+// needsAWSSigning reports whether requests should be SigV4 signed, either
+// because the user passed AWS flags explicitly or because the environment
+// looks like an AWS-managed credential source (EKS IRSA, ECS task role, or
+// a shared config profile). Plain EC2 instance-profile credentials have no
+// corresponding environment variable to detect here short of probing the
+// instance metadata service, which this check does not do; run with
+// -aws-region (or set AWS_REGION) on EC2 to opt into signing.
+func (config *EsRollConfig) needsAWSSigning() bool {
+	if config.AWSAccessKey != "" || config.AWSRegion != "" || config.AWSProfile != "" || config.AWSRoleArn != "" || config.AWSWebIdentityTokenFile != "" {
+		return true
+	}
+	if os.Getenv("AWS_REGION") != "" || os.Getenv("AWS_ROLE_ARN") != "" || os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != "" || os.Getenv("AWS_PROFILE") != "" {
+		return true
+	}
+	return os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" || os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != ""
+}
+
+// awsCredentials resolves the credentials and region to sign requests with.
+// It prefers the default AWS credential chain (shared config, env vars, EC2
+// instance profile, ECS task role, or EKS IRSA via the web identity token
+// file), which refreshes automatically as credentials near expiry, so a
+// long-running daemon with STS credentials keeps working past the first
+// hour. An explicit -aws-role-arn/-aws-web-identity-token-file pair
+// overrides what the chain would otherwise pick up, for assuming a role
+// other than the one implied by the environment.
+func (config *EsRollConfig) awsCredentials() (*credentials.Credentials, string, error) {
+	region := config.AWSRegion
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	sessOpts := session.Options{SharedConfigState: session.SharedConfigEnable}
+	if config.AWSProfile != "" {
+		sessOpts.Profile = config.AWSProfile
+	}
+	if config.AWSAccessKey != "" {
+		sessOpts.Config.Credentials = credentials.NewStaticCredentials(config.AWSAccessKey, config.AWSSecretKey, "")
+	}
+	if region != "" {
+		sessOpts.Config.Region = awssdk.String(region)
+	}
+	sess, err := session.NewSessionWithOptions(sessOpts)
+	if err != nil {
+		return nil, "", err
+	}
+	creds := sess.Config.Credentials
+	if config.AWSRoleArn != "" && config.AWSWebIdentityTokenFile != "" {
+		creds = stscreds.NewWebIdentityCredentials(sess, config.AWSRoleArn, "esroll", config.AWSWebIdentityTokenFile)
+	}
+	if region == "" {
+		region = awssdk.StringValue(sess.Config.Region)
+	}
+	if region == "" {
+		if metadataRegion, metadataErr := ec2metadata.New(sess).Region(); metadataErr == nil {
+			region = metadataRegion
+		}
+	}
+	return creds, region, nil
+}
+
 func (config *EsRollConfig) needsSecureScheme() bool {
 	if config.ElasticUrl != "" {
 		if strings.HasPrefix(config.ElasticUrl, "https") {
@@ -409,28 +838,24 @@ func (config *EsRollConfig) needsSecureScheme() bool {
 	return false
 }
 
-func (config *EsRollConfig) newElasticClient() (client *elastic.Client, err error) {
-	var clientOptions []elastic.ClientOptionFunc
-	var httpClient *http.Client
-	if config.needsSecureScheme() {
-		clientOptions = append(clientOptions, elastic.SetScheme("https"))
-	}
-	if config.ElasticUrl != "" {
-		clientOptions = append(clientOptions, elastic.SetURL(config.ElasticUrl))
+func (config *EsRollConfig) newElasticClient() (esclient.EsClient, error) {
+	httpClient, err := config.NewHTTPClient()
+	if err != nil {
+		return nil, err
 	}
-	if config.ElasticUser != "" {
-		clientOptions = append(clientOptions, elastic.SetBasicAuth(config.ElasticUser, config.ElasticPassword))
+	opts := esclient.Options{
+		URL:        config.ElasticUrl,
+		User:       config.ElasticUser,
+		Password:   config.ElasticPassword,
+		HTTPClient: httpClient,
 	}
-	httpClient, err = config.NewHTTPClient()
-	if err != nil {
-		return client, err
+	if config.needsSecureScheme() {
+		opts.Scheme = "https"
 	}
-	clientOptions = append(clientOptions, elastic.SetHttpClient(httpClient))
-	return elastic.NewClient(clientOptions...)
+	return esclient.New(context.Background(), opts)
 }
 
 func main() {
-	log.SetPrefix("ERROR ")
 	var mainConfig EsRollConfig
 	var showVersion bool
 	flag.BoolVar(&showVersion, "v", false, "True to print the version number")
@@ -442,43 +867,74 @@ func main() {
 	flag.BoolVar(&mainConfig.Insecure, "insecure", false, "Disable TLS validation")
 	flag.StringVar(&mainConfig.AWSAccessKey, "aws-access-key", "", "AWS access key")
 	flag.StringVar(&mainConfig.AWSSecretKey, "aws-secret-key", "", "AWS secret key")
-	flag.StringVar(&mainConfig.AWSRegion, "aws-region", "", "AWS region")
+	flag.StringVar(&mainConfig.AWSRegion, "aws-region", "", "AWS region, auto-detected from AWS_REGION/instance metadata when unset")
+	flag.StringVar(&mainConfig.AWSProfile, "aws-profile", "", "AWS shared config/credentials profile to use")
+	flag.StringVar(&mainConfig.AWSRoleArn, "aws-role-arn", "", "AWS role ARN to assume via web identity federation (e.g. EKS IRSA)")
+	flag.StringVar(&mainConfig.AWSWebIdentityTokenFile, "aws-web-identity-token-file", "", "Path to a web identity token file, used with -aws-role-arn")
+	var configDir string
+	flag.StringVar(&configDir, "config-dir", "", "Directory of local YAML/JSON config files, watched for changes, for air-gapped setups")
+	var metricsAddr string
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "Address to serve Prometheus metrics and /healthz on, e.g. :9090")
 	flag.Parse()
 	if showVersion {
 		fmt.Println(Version)
 		os.Exit(0)
 	}
+	if metricsAddr != "" {
+		server := StartMetricsServer(metricsAddr)
+		defer server.Close()
+	}
 	client, err := mainConfig.newElasticClient()
 	if err != nil {
 		panic(fmt.Sprintf("Unable to create elasticsearch client: %s", err))
 	}
+	pingCluster(client)
 	configs, err := GetConfigs(client)
 	if err != nil {
 		if mainConfig.Daemon {
-			log.Println("Configuration for esroll invalid or not found, waiting till one exists")
+			logger.Warn("configuration for esroll invalid or not found, waiting till one exists")
 		} else {
-			log.Println("Configuration for esroll invalid or not found")
+			logger.Error("configuration for esroll invalid or not found")
 		}
 		fmt.Println("You can create one with ...")
 		fmt.Println(ExampleConfig)
 		if !mainConfig.Daemon {
 			os.Exit(1)
 		}
+	} else {
+		health.recordConfigLoad(time.Now())
 	}
 	if mainConfig.Daemon {
 		var configTicker = time.NewTicker(10 * time.Second)
 		var sizeTicker = time.NewTicker(10 * time.Second)
+		var metricsTicker = time.NewTicker(30 * time.Second)
+		var pingTicker = time.NewTicker(30 * time.Second)
 		var workQ = make(chan (time.Time))
 		var initQ = make(chan (IndexConfig))
-		go func(client *elastic.Client) {
+		watcher := NewConfigWatcher(client, configDir)
+		if dirConfigs, err := watcher.LoadDir(); err != nil {
+			logger.Error("unable to load config-dir", "dir", configDir, "error", err)
+		} else {
+			for _, c := range dirConfigs {
+				configs = append(configs, c)
+				go func(c IndexConfig) {
+					initQ <- c
+				}(c)
+			}
+			if err := watcher.WatchDir(initQ); err != nil {
+				logger.Error("unable to watch config-dir", "dir", configDir, "error", err)
+			}
+		}
+		go func() {
 			sigs := make(chan os.Signal, 1)
 			signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
 			<-sigs
 			configTicker.Stop()
 			sizeTicker.Stop()
-			client.Stop()
+			metricsTicker.Stop()
+			pingTicker.Stop()
 			os.Exit(0)
-		}(client)
+		}()
 		go func() {
 			var clock = time.NewTicker(1 * time.Second)
 			for t := range clock.C {
@@ -493,29 +949,32 @@ func main() {
 			case t := <-workQ:
 				for _, conf := range configs {
 					if conf.ShouldRoll(t) {
-						if err := conf.Roll(client, t); err != nil {
-							log.Println(err)
-						}
+						go rollAndRecord(conf, client, t)
 					}
 				}
 			case <-sizeTicker.C:
 				for _, conf := range configs {
-					if conf.RollsOnSize() {
-						if err := conf.Roll(client, time.Now().UTC()); err != nil {
-							log.Println(err)
-						}
+					if conf.RollsOnSize() || conf.RollsOnRollover() {
+						go rollAndRecord(conf, client, time.Now().UTC())
 					}
 				}
 			case conf := <-initQ:
-				if err := conf.Roll(client, time.Now().UTC()); err != nil {
-					log.Println(err)
-				}
+				go rollAndRecord(conf, client, time.Now().UTC())
+			case <-metricsTicker.C:
+				refreshIndexMetrics(configs, client)
+			case <-pingTicker.C:
+				pingCluster(client)
 			case <-configTicker.C:
-				configs, err = GetConfigs(client)
+				changed, reloadErrors, err := watcher.Refresh()
+				if reloadErrors > 0 {
+					configReloadErrors.Add(float64(reloadErrors))
+					logger.Warn("skipped invalid esroll configuration documents", "count", reloadErrors)
+				}
 				if err == nil {
-					for _, config := range configs {
-						exists := client.IndexExists(config.TargetIndex)
-						ok, _ := exists.Do(context.Background())
+					configs = watcher.Configs()
+					health.recordConfigLoad(time.Now())
+					for _, config := range changed {
+						ok, _ := client.IndexExists(context.Background(), config.TargetIndex)
 						if !ok {
 							go func(c IndexConfig) {
 								initQ <- c
@@ -523,15 +982,15 @@ func main() {
 						}
 					}
 				} else {
-					log.Println(err)
+					logger.Error("unable to refresh configs", "error", err)
 				}
 			}
 		}
 	} else {
 		for _, conf := range configs {
-			if err := conf.Roll(client, time.Now().UTC()); err != nil {
-				log.Println(err)
-			}
+			start := time.Now()
+			err := conf.Roll(client, time.Now().UTC())
+			recordRoll(conf, start, err)
 		}
 	}
 }
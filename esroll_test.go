@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rwynn/esroll/esclient"
+)
+
+// fakeClient is a minimal esclient.EsClient stub for exercising roll/phase
+// logic without a real cluster. Only the methods a given test needs return
+// anything interesting; the rest are no-ops.
+type fakeClient struct {
+	catIndices     []esclient.CatIndex
+	aliasesApplied []esclient.AliasAction
+	deleted        []string
+	markers        map[string]bool
+
+	// taskCompletedResults is consumed in order by TaskCompleted, one bool
+	// per call; once exhausted it keeps returning its last element.
+	taskCompletedResults []bool
+	taskCompletedCalls   int
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{markers: make(map[string]bool)}
+}
+
+func (f *fakeClient) Version(ctx context.Context) (string, error) { return "7.17.0", nil }
+func (f *fakeClient) IndexExists(ctx context.Context, name string) (bool, error) {
+	return false, nil
+}
+func (f *fakeClient) CreateIndex(ctx context.Context, name string, settings map[string]interface{}) error {
+	return nil
+}
+func (f *fakeClient) CreateIndexWithWriteAlias(ctx context.Context, name, alias string, settings map[string]interface{}) error {
+	return nil
+}
+func (f *fakeClient) Rollover(ctx context.Context, alias string, conditions esclient.RolloverConditions) (esclient.RolloverResult, error) {
+	return esclient.RolloverResult{}, nil
+}
+func (f *fakeClient) CatIndices(ctx context.Context, pattern string) ([]esclient.CatIndex, error) {
+	return f.catIndices, nil
+}
+func (f *fakeClient) ApplyAliases(ctx context.Context, actions []esclient.AliasAction) error {
+	f.aliasesApplied = append(f.aliasesApplied, actions...)
+	for _, a := range actions {
+		f.markers[a.Index+"|"+a.Alias] = !a.Remove
+	}
+	return nil
+}
+func (f *fakeClient) DeleteIndices(ctx context.Context, names []string) error {
+	f.deleted = append(f.deleted, names...)
+	return nil
+}
+func (f *fakeClient) CloseIndices(ctx context.Context, names []string) error { return nil }
+func (f *fakeClient) FlushIndices(ctx context.Context, names []string) error { return nil }
+func (f *fakeClient) PutSettings(ctx context.Context, names []string, settings map[string]interface{}) error {
+	return nil
+}
+func (f *fakeClient) Forcemerge(ctx context.Context, names []string, maxSegments int) error {
+	return nil
+}
+func (f *fakeClient) AliasExists(ctx context.Context, index, alias string) (bool, error) {
+	return f.markers[index+"|"+alias], nil
+}
+func (f *fakeClient) Shrink(ctx context.Context, source, target string, settings map[string]interface{}) error {
+	return nil
+}
+func (f *fakeClient) Freeze(ctx context.Context, index string) error { return nil }
+func (f *fakeClient) SearchConfigs(ctx context.Context, index string) ([]esclient.ConfigDoc, error) {
+	return nil, nil
+}
+func (f *fakeClient) Reindex(ctx context.Context, source, dest string, opts esclient.ReindexOptions) (string, error) {
+	return "", nil
+}
+func (f *fakeClient) TaskCompleted(ctx context.Context, task string) (bool, error) {
+	defer func() { f.taskCompletedCalls++ }()
+	if len(f.taskCompletedResults) == 0 {
+		return true, nil
+	}
+	if f.taskCompletedCalls < len(f.taskCompletedResults) {
+		return f.taskCompletedResults[f.taskCompletedCalls], nil
+	}
+	return f.taskCompletedResults[len(f.taskCompletedResults)-1], nil
+}
+
+// TestValidateRejectsPhasesWithRollover verifies that a config cannot
+// combine rollMode:rollover with phases, since ApplyPhases can never see
+// rollover-managed indices (they're named TargetIndex-000001, not
+// TargetIndex_<suffix>).
+func TestValidateRejectsPhasesWithRollover(t *testing.T) {
+	config := IndexConfig{
+		Id:       "logs",
+		RollMode: "rollover",
+		Rollover: &RolloverConfig{MaxAge: "1d"},
+		Phases: []Phase{
+			{Name: "warm", AfterRolls: 1, Actions: []PhaseAction{{Type: "readonly"}}},
+		},
+	}
+	if err := config.Validate(); err == nil {
+		t.Fatal("expected Validate to reject phases combined with rollMode:rollover")
+	}
+}
+
+func TestPhaseReached(t *testing.T) {
+	cases := []struct {
+		name       string
+		phase      Phase
+		rollsSince int
+		age        time.Duration
+		want       bool
+	}{
+		{"afterRolls met", Phase{AfterRolls: 3}, 3, 0, true},
+		{"afterRolls not met", Phase{AfterRolls: 3}, 2, 0, false},
+		{"afterAge met", Phase{AfterAge: "1d"}, 0, 25 * time.Hour, true},
+		{"afterAge not met", Phase{AfterAge: "1d"}, 0, time.Hour, false},
+		{"neither set", Phase{}, 10, 1000 * time.Hour, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.phase.reached(c.rollsSince, c.age); got != c.want {
+				t.Errorf("reached(%d, %v) = %v, want %v", c.rollsSince, c.age, got, c.want)
+			}
+		})
+	}
+}
+
+// TestApplyPhasesMarksNonDeletingAction verifies that a phase which only
+// changes index settings gets a marker alias applied, so a later call skips
+// it.
+func TestApplyPhasesMarksNonDeletingAction(t *testing.T) {
+	client := newFakeClient()
+	client.catIndices = []esclient.CatIndex{{Name: "logs_2020-01-01", Status: "open"}}
+	config := IndexConfig{
+		Id:          "logs",
+		TargetIndex: "logs",
+		RollUnit:    "days",
+		Phases: []Phase{
+			{Name: "warm", AfterRolls: 1, Actions: []PhaseAction{{Type: "readonly"}}},
+		},
+	}
+	if err := config.ApplyPhases(client, time.Now()); err != nil {
+		t.Fatalf("ApplyPhases: %v", err)
+	}
+	if !client.markers["logs_2020-01-01|"+phaseMarker("logs_2020-01-01", "warm")] {
+		t.Fatalf("expected marker alias to be applied for the warm phase")
+	}
+	if len(client.deleted) != 0 {
+		t.Fatalf("expected no indices deleted, got %v", client.deleted)
+	}
+}
+
+// TestApplyPhasesSkipsMarkerAfterDelete verifies that a phase whose action
+// deletes the index does not then try to alias a marker onto the
+// now-nonexistent index.
+func TestApplyPhasesSkipsMarkerAfterDelete(t *testing.T) {
+	client := newFakeClient()
+	client.catIndices = []esclient.CatIndex{{Name: "logs_2020-01-01", Status: "open"}}
+	config := IndexConfig{
+		Id:          "logs",
+		TargetIndex: "logs",
+		RollUnit:    "days",
+		Phases: []Phase{
+			{Name: "expire", AfterRolls: 1, Actions: []PhaseAction{{Type: "delete"}}},
+		},
+	}
+	if err := config.ApplyPhases(client, time.Now()); err != nil {
+		t.Fatalf("ApplyPhases: %v", err)
+	}
+	if len(client.deleted) != 1 || client.deleted[0] != "logs_2020-01-01" {
+		t.Fatalf("expected logs_2020-01-01 to be deleted, got %v", client.deleted)
+	}
+	if len(client.aliasesApplied) != 0 {
+		t.Fatalf("expected no marker alias to be applied after delete, got %v", client.aliasesApplied)
+	}
+}
+
+// withFastReindexPolling shrinks reindexOnRoll's poll budget and removes the
+// real sleep so its completion/timeout paths can be tested without waiting
+// on the real backoff schedule. It returns a func that restores the
+// originals.
+func withFastReindexPolling(maxAttempts int) func() {
+	origAttempts, origSleep := reindexMaxPollAttempts, reindexSleep
+	reindexMaxPollAttempts = maxAttempts
+	reindexSleep = func(time.Duration) {}
+	return func() {
+		reindexMaxPollAttempts = origAttempts
+		reindexSleep = origSleep
+	}
+}
+
+func TestReindexOnRollCompletes(t *testing.T) {
+	defer withFastReindexPolling(5)()
+	client := newFakeClient()
+	client.taskCompletedResults = []bool{false, false, true}
+	config := IndexConfig{
+		Id:          "logs",
+		TargetIndex: "logs",
+		OnRoll:      &OnRollConfig{Reindex: &ReindexOnRollConfig{MaxDocs: 1000}},
+	}
+	if err := config.reindexOnRoll(client, "logs_2020-01-01", "logs_2020-01-02"); err != nil {
+		t.Fatalf("reindexOnRoll: %v", err)
+	}
+	if client.taskCompletedCalls != 3 {
+		t.Fatalf("expected TaskCompleted to be polled 3 times, got %d", client.taskCompletedCalls)
+	}
+}
+
+func TestReindexOnRollTimesOut(t *testing.T) {
+	defer withFastReindexPolling(3)()
+	client := newFakeClient()
+	client.taskCompletedResults = []bool{false}
+	config := IndexConfig{
+		Id:          "logs",
+		TargetIndex: "logs",
+		OnRoll:      &OnRollConfig{Reindex: &ReindexOnRollConfig{}},
+	}
+	err := config.reindexOnRoll(client, "logs_2020-01-01", "logs_2020-01-02")
+	if err == nil {
+		t.Fatal("expected reindexOnRoll to return an error after exhausting its poll budget")
+	}
+	if client.taskCompletedCalls != 3 {
+		t.Fatalf("expected exactly 3 polls, got %d", client.taskCompletedCalls)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/rwynn/esroll/esclient"
+)
+
+var (
+	rollsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "esroll_rolls_total",
+		Help: "Total number of roll attempts, by config and result (ok or error).",
+	}, []string{"config", "result"})
+
+	rollDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "esroll_roll_duration_seconds",
+		Help: "Time spent in IndexConfig.Roll, by config.",
+	}, []string{"config"})
+
+	indexPrimaryBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "esroll_index_primary_bytes",
+		Help: "Primary store size in bytes of each index managed by a config.",
+	}, []string{"config", "index"})
+
+	indicesOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "esroll_indices_open",
+		Help: "Number of open indices, by config.",
+	}, []string{"config"})
+
+	indicesClosed = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "esroll_indices_closed",
+		Help: "Number of closed indices, by config.",
+	}, []string{"config"})
+
+	lastRollTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "esroll_last_roll_timestamp_seconds",
+		Help: "Unix timestamp of the last successful roll, by config.",
+	}, []string{"config"})
+
+	configReloadErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "esroll_config_reload_errors_total",
+		Help: "Total number of configuration documents that failed to parse or validate on reload.",
+	})
+
+	forcemergeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "esroll_forcemerge_duration_seconds",
+		Help: "Time spent waiting for forcemerge to complete, by config.",
+	}, []string{"config"})
+)
+
+// health tracks the daemon's last successful ES ping and config load times,
+// served at /healthz for container orchestrators.
+var health = &healthStatus{}
+
+type healthStatus struct {
+	mu             sync.Mutex
+	lastPing       time.Time
+	lastConfigLoad time.Time
+}
+
+func (h *healthStatus) recordPing(t time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastPing = t
+}
+
+func (h *healthStatus) recordConfigLoad(t time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastConfigLoad = t
+}
+
+func (h *healthStatus) snapshot() (lastPing, lastConfigLoad time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastPing, h.lastConfigLoad
+}
+
+// ServeHTTP reports the last successful ping and config load times as JSON.
+// A cluster ping older than 2 minutes is reported unhealthy with a 503.
+func (h *healthStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	lastPing, lastConfigLoad := h.snapshot()
+	healthy := !lastPing.IsZero() && time.Since(lastPing) < 2*time.Minute
+	w.Header().Set("Content-Type", "application/json")
+	if !healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"healthy":        healthy,
+		"lastPing":       lastPing,
+		"lastConfigLoad": lastConfigLoad,
+	})
+}
+
+// StartMetricsServer exposes Prometheus metrics at /metrics and health
+// status at /healthz on addr. It runs in the background and logs any error
+// ListenAndServe returns other than http.ErrServerClosed.
+func StartMetricsServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/healthz", health)
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("metrics server stopped", "error", err)
+		}
+	}()
+	return server
+}
+
+// pingCluster records a health check by asking the cluster whether the
+// esroll index exists, treating any error as a failed ping; a missing index
+// still counts as a successful ping.
+func pingCluster(client esclient.EsClient) {
+	if _, err := client.IndexExists(context.Background(), "esroll"); err == nil {
+		health.recordPing(time.Now())
+	}
+}
+
+// recordRoll updates esroll_rolls_total, esroll_roll_duration_seconds, and
+// esroll_last_roll_timestamp_seconds for a single Roll call, and logs the
+// outcome with structured fields.
+func recordRoll(config IndexConfig, start time.Time, err error) {
+	duration := time.Since(start)
+	rollDuration.WithLabelValues(config.Id).Observe(duration.Seconds())
+	result := "ok"
+	if err != nil {
+		result = "error"
+		logger.Error("roll failed", "config", config.Id, "target", config.TargetIndex, "duration", duration, "error", err)
+	} else {
+		lastRollTimestamp.WithLabelValues(config.Id).Set(float64(time.Now().Unix()))
+		logger.Info("roll completed", "config", config.Id, "target", config.TargetIndex, "duration", duration)
+	}
+	rollsTotal.WithLabelValues(config.Id, result).Inc()
+}
+
+// refreshIndexMetrics sets esroll_index_primary_bytes, esroll_indices_open,
+// and esroll_indices_closed for every config, by scanning its TargetIndex_*
+// indices. Forcemerge duration is recorded separately, from within Roll,
+// since it is not observable from a cat indices scan.
+func refreshIndexMetrics(configs Configs, client esclient.EsClient) {
+	ctx := context.Background()
+	for _, config := range configs {
+		rows, err := client.CatIndices(ctx, config.TargetIndex+"_*")
+		if err != nil {
+			logger.Warn("unable to refresh index metrics", "config", config.Id, "error", err)
+			continue
+		}
+		var open, closed float64
+		for _, row := range rows {
+			if row.Status == "open" {
+				open++
+			} else {
+				closed++
+			}
+			if bytes, err := humanize.ParseBytes(row.PriStoreSize); err == nil {
+				indexPrimaryBytes.WithLabelValues(config.Id, row.Name).Set(float64(bytes))
+			}
+		}
+		indicesOpen.WithLabelValues(config.Id).Set(open)
+		indicesClosed.WithLabelValues(config.Id).Set(closed)
+	}
+}